@@ -0,0 +1,502 @@
+package audio
+
+import (
+	"context"
+	"fmt"
+	"image/color"
+	"math"
+	"math/cmplx"
+	"sync"
+	"time"
+
+	gcolor "github.com/gookit/color"
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/pkg/errors"
+	"github.com/sgreben/piecewiselinear"
+	"gonum.org/v1/gonum/dsp/fourier"
+	"gonum.org/v1/gonum/dsp/window"
+
+	"ledctl3/internal/client/visualizer"
+	"ledctl3/pkg/gradient"
+)
+
+// CaptureBackend abstracts a platform audio capture API so that Visualizer
+// does not need to know whether samples come from WASAPI, PortAudio or a
+// PulseAudio monitor source. Open is called once per capture session,
+// ReadFrame is called in a loop until it returns an error, and Close
+// releases any resources acquired by Open.
+type CaptureBackend interface {
+	Open(sampleRate, channels, bufferFrames int) error
+	// ReadFrame blocks until a frame is available, ctx is cancelled, or the
+	// backend fails. Implementations must return promptly once ctx is done
+	// rather than relying solely on Close to unblock them.
+	ReadFrame(ctx context.Context) (samples []float64, peak float64, err error)
+	// SampleRate returns the rate samples are actually delivered at, which
+	// may differ from the sampleRate requested of Open. Only valid after
+	// Open succeeds.
+	SampleRate() int
+	Close() error
+}
+
+const (
+	defaultSampleRate   = 44100
+	defaultChannels     = 2
+	defaultBufferFrames = 1024
+)
+
+type Visualizer struct {
+	mux sync.Mutex
+
+	leds     int
+	colors   []color.Color
+	segments []Segment
+
+	events      chan visualizer.UpdateEvent
+	cancel      context.CancelFunc
+	childCancel context.CancelFunc
+	done        chan bool
+	maxLedCount int
+
+	processing bool
+
+	gradient   gradient.Gradient
+	windowSize int
+
+	backend    string
+	source     string
+	sourcePath string
+
+	beatMode    string
+	sensitivity float64
+	minBPM      float64
+	maxBPM      float64
+	beat        *beatTracker
+
+	scale        string
+	fMin, fMax   float64
+	attack       time.Duration
+	release      time.Duration
+	noiseFloor   float64
+	filterbank   *melFilterbank
+	agc          *bandAGC
+	fbBins       int
+	fbSampleRate int
+	fbFFTSize    int
+
+	sampleRate int
+}
+
+func (v *Visualizer) Start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	v.cancel = cancel
+	v.done = make(chan bool)
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				v.done <- true
+				return
+			default:
+				var childCtx context.Context
+				childCtx, v.childCancel = context.WithCancel(ctx)
+
+				err := v.startCapture(childCtx)
+				if errors.Is(err, context.Canceled) {
+					return
+				} else if err != nil {
+					time.Sleep(1 * time.Second)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (v *Visualizer) Events() chan visualizer.UpdateEvent {
+	return v.events
+}
+
+func (v *Visualizer) Stop() error {
+	if v.cancel != nil {
+		v.cancel()
+		v.cancel = nil
+	}
+
+	<-v.done
+
+	return nil
+}
+
+// startCapture opens the sampleSource selected by v.source/v.backend and
+// feeds the frames it produces into v.process until ctx is cancelled or the
+// source returns an error.
+func (v *Visualizer) startCapture(ctx context.Context) error {
+	src, err := newSampleSource(v.source, v.sourcePath, v.backend)
+	if err != nil {
+		return err
+	}
+
+	if err := src.Open(defaultSampleRate, defaultChannels, defaultBufferFrames); err != nil {
+		return err
+	}
+	defer src.Close()
+
+	v.mux.Lock()
+	v.sampleRate = src.SampleRate()
+	v.mux.Unlock()
+
+	for {
+		samples, peak, err := src.ReadSamples(ctx)
+		if err != nil {
+			return err
+		}
+
+		go v.process(samples, peak)
+	}
+}
+
+func SpanLog(min, max float64, nPoints int) []float64 {
+	X := make([]float64, nPoints)
+	min, max = math.Min(max, min), math.Max(max, min)
+	d := max - min
+	for i := range X {
+		v := min + d*(float64(i)/float64(nPoints-1))
+		v = math.Pow(v, 0.5)
+		X[i] = v
+	}
+	return X
+}
+
+func reverse[S ~[]E, E any](s S) {
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+}
+
+var it int
+
+func (v *Visualizer) process(samples []float64, peak float64) {
+	now := time.Now()
+
+	v.mux.Lock()
+	if v.processing {
+		v.mux.Unlock()
+		return
+	}
+
+	v.processing = true
+	grad := v.gradient
+	windowSize := v.windowSize
+	segments := v.segments
+	events := v.events
+	sampleRate := v.sampleRate
+	v.mux.Unlock()
+
+	if sampleRate == 0 {
+		sampleRate = defaultSampleRate
+	}
+
+	defer func() {
+		v.mux.Lock()
+		v.processing = false
+		v.mux.Unlock()
+	}()
+
+	e := 0.0
+	for _, s := range samples {
+		e += math.Pow(math.Abs(s), 2)
+	}
+	e /= math.MaxUint64
+
+	e = math.Max(e, 0)
+	e = math.Min(e, 1)
+
+	fft := fourier.NewFFT(len(samples))
+	coeff := fft.Coefficients(nil, window.Hamming(samples))
+
+	freqs := []float64{}
+	var maxfreq float64
+
+	coeff = coeff[:len(coeff)/2]
+	for _, c := range coeff {
+		freqs = append(freqs, cmplx.Abs(c))
+		if cmplx.Abs(c) > maxfreq {
+			maxfreq = cmplx.Abs(c)
+		}
+	}
+
+	if peak == 0 {
+		for i := range freqs {
+			freqs[i] = 0
+		}
+	}
+
+	// beat tracking needs real magnitudes, not per-frame self-normalized
+	// ones: normalizing each frame to its own max flattens every frame's
+	// peak to 1.0, which destroys the frame-to-frame energy change that
+	// spectral flux is supposed to detect.
+	rawMag := append([]float64(nil), freqs...)
+
+	for i, f := range freqs {
+		norm := normalize(f, 0, maxfreq)
+		freqs[i] = norm
+	}
+
+	var onset bool
+	var beatPhase float64
+	if v.beatMode != "" && v.beatMode != "off" {
+		if v.beat == nil {
+			v.beat = newBeatTracker(v.sensitivity, v.minBPM, v.maxBPM)
+		}
+		onset, beatPhase = v.beat.update(rawMag, now)
+	}
+
+	maxLeds := v.maxLedCount
+
+	switch v.scale {
+	case "mel", "bark":
+		fftSize := len(samples)
+		if v.filterbank == nil || v.fbBins != len(freqs) || v.fbSampleRate != sampleRate || v.fbFFTSize != fftSize {
+			v.filterbank = newMelFilterbank(len(freqs), maxLeds, float64(sampleRate), v.fMin, v.fMax, v.scale, fftSize)
+			v.agc = newBandAGC(maxLeds, v.attack, v.release, v.noiseFloor)
+			v.fbBins = len(freqs)
+			v.fbSampleRate = sampleRate
+			v.fbFFTSize = fftSize
+		}
+
+		freqs = v.agc.apply(v.filterbank.apply(freqs), now)
+	case "linear":
+		f := piecewiselinear.Function{Y: freqs}
+		f.X = make([]float64, len(f.Y))
+		for i := range f.X {
+			f.X[i] = float64(i) / float64(len(f.X)-1)
+		}
+
+		resampled := make([]float64, maxLeds)
+		for i := 0; i < maxLeds; i++ {
+			resampled[i] = f.At(float64(i) / float64(maxLeds-1))
+		}
+		freqs = resampled
+	default: // "", "log": the original x^0.5 warp across raw bins
+		f := piecewiselinear.Function{Y: freqs}
+		f.X = SpanLog(0, 1, len(f.Y))
+
+		resampled := make([]float64, maxLeds)
+		for i := 0; i < maxLeds; i++ {
+			resampled[i] = f.At(float64(i) / float64(maxLeds-1))
+		}
+		freqs = resampled
+	}
+
+	pix := []byte{}
+
+	for i := 0; i < maxLeds; i++ {
+		freq := freqs[i]
+
+		c := grad.GetInterpolatedColor(freq)
+		clr, _ := colorful.MakeColor(c)
+
+		hue, sat, val := clr.Hsv()
+
+		val = math.Sqrt(1 - math.Pow(freq-1, 2))
+
+		val = math.Min(peak*5, 1) * val
+		val = math.Min(val, 1)
+		val = math.Max(val, 0)
+		val = 0.25 + val*0.75
+
+		switch v.beatMode {
+		case "pulse":
+			if onset {
+				hue = math.Mod(hue+40, 360)
+				val = 1
+			}
+		case "breathe":
+			breathe := 0.5 + 0.5*math.Sin(2*math.Pi*beatPhase-math.Pi/2)
+			val = val*0.5 + breathe*0.5
+		}
+
+		c = colorful.Hsv(hue, sat, val)
+
+		r, g, b, _ := c.RGBA()
+
+		r = r >> 8
+		g = g >> 8
+		b = b >> 8
+
+		pix = append(pix, []byte{uint8(r), uint8(g), uint8(b), 0xFF}...)
+	}
+
+	v.mux.Lock()
+	pixs = append(pixs, pix)
+	if len(pixs) > windowSize {
+		pixs = pixs[1:]
+	}
+	pixsSnapshot := append([][]byte(nil), pixs...)
+	v.mux.Unlock()
+
+	weights := []float64{}
+	weightsTotal := 0.0
+
+	for i := 0; i < len(pixsSnapshot); i++ {
+		// for each history item
+		w := float64((i+1)*(i+1) + len(pixsSnapshot)*len(pixsSnapshot))
+
+		weights = append(weights, w)
+		weightsTotal += w
+	}
+
+	pix2 := make([]float64, len(pix))
+	for i, p2 := range pixsSnapshot {
+		for j, p := range p2 {
+			pix2[j] = pix2[j] + float64(p)*weights[i]
+		}
+	}
+
+	pix3 := make([]float64, len(pix))
+	for i, p := range pix2 {
+		avg := p / weightsTotal
+		pix3[i] = float64(avg)
+	}
+
+	segs := []visualizer.Segment{}
+
+	for _, seg := range segments {
+		length := seg.Leds * 4
+		pix4 := make([]uint8, length)
+
+		for i := 0; i < length; i += 4 {
+			offset := i
+
+			pix4[i] = uint8(pix3[offset])
+			pix4[i+1] = uint8(pix3[offset+1])
+			pix4[i+2] = uint8(pix3[offset+2])
+			pix4[i+3] = uint8(pix3[offset+3])
+		}
+
+		pix := pix4[:seg.Leds*4]
+
+		if seg.Id == 0 {
+			out := "\n"
+			for i := 0; i < len(pix); i += 4 {
+				out += gcolor.RGB(pix[i], pix[i+1], pix[i+2], true).Sprintf(" ")
+			}
+			fmt.Print(out)
+		}
+		it++
+
+		segs = append(segs, visualizer.Segment{
+			Id:  seg.Id,
+			Pix: pix,
+		})
+	}
+
+	events <- visualizer.UpdateEvent{
+		Segments: segs,
+		Duration: time.Since(now),
+	}
+}
+
+// readInt32 reads a signed integer from a byte slice. only a slice with len(4)
+// should be passed. equivalent of int32(binary.LittleEndian.Uint32(b))
+func readInt32(b []byte) int32 {
+	return int32(uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24)
+}
+
+// readInt16 reads a signed integer from a byte slice. only a slice with len(2)
+// should be passed. equivalent of int16(binary.LittleEndian.Uint16(b))
+func readInt16(b []byte) int16 {
+	return int16(uint32(b[0]) | uint32(b[1])<<8)
+}
+
+// normalize scales a value from min,max to 0,1
+func normalize(val, min, max float64) float64 {
+	if max == min {
+		return max
+	}
+
+	return (val - min) / (max - min)
+}
+
+var pixs [][]byte
+
+func New(opts ...Option) (v *Visualizer, err error) {
+	v = new(Visualizer)
+
+	for _, opt := range opts {
+		err := opt(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	v.gradient, err = gradient.New(v.colors...)
+	if err != nil {
+		return nil, err
+	}
+
+	v.events = make(chan visualizer.UpdateEvent, len(v.segments)*8)
+
+	return v, nil
+}
+
+// Backend selects the CaptureBackend used for live system audio capture,
+// e.g. "wasapi", "portaudio", "pulse" or "auto" to pick a sensible default
+// for the current OS.
+func Backend(name string) Option {
+	return func(v *Visualizer) error {
+		v.backend = name
+		return nil
+	}
+}
+
+// Source selects where samples come from: "system" (the default) captures
+// live audio through the configured CaptureBackend, "file" decodes samples
+// from path instead, which is useful for deterministic testing and demos on
+// machines with no working capture backend.
+func Source(name, path string) Option {
+	return func(v *Visualizer) error {
+		v.source = name
+		v.sourcePath = path
+		return nil
+	}
+}
+
+// Beat enables beat-synchronous coloring. mode is "off" (the default),
+// "pulse" (flash on each detected onset) or "breathe" (brightness follows
+// the beat phase). sensitivity raises or lowers the onset threshold above
+// the novelty function's recent mean, and minBPM/maxBPM bound the tempo
+// search range.
+func Beat(mode string, sensitivity, minBPM, maxBPM float64) Option {
+	return func(v *Visualizer) error {
+		v.beatMode = mode
+		v.sensitivity = sensitivity
+		v.minBPM = minBPM
+		v.maxBPM = maxBPM
+		return nil
+	}
+}
+
+// Scale selects how the magnitude spectrum is mapped onto LEDs: "log" (the
+// default, a crude x^0.5 warp across raw bins), "linear" (even spacing
+// across raw bins), or "mel"/"bark" (a perceptual filterbank with per-band
+// AGC between fMin and fMax Hz, using attack/release as the AGC envelope
+// time constants and noiseFloor to gate bands below it).
+func Scale(scale string, fMin, fMax float64, attack, release time.Duration, noiseFloor float64) Option {
+	return func(v *Visualizer) error {
+		v.scale = scale
+		v.fMin = fMin
+		v.fMax = fMax
+		v.attack = attack
+		v.release = release
+		v.noiseFloor = noiseFloor
+		return nil
+	}
+}
+
+type Segment struct {
+	Id   int
+	Leds int
+}
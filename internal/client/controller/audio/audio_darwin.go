@@ -0,0 +1,18 @@
+//go:build darwin
+
+package audio
+
+import "fmt"
+
+// newCaptureBackend resolves the backend name to a CaptureBackend on macOS.
+// PortAudio is the only backend available here, and is also what "auto"
+// resolves to; it requires a loopback input device (e.g. BlackHole) to be
+// configured as the default input.
+func newCaptureBackend(name string) (CaptureBackend, error) {
+	switch name {
+	case "", "auto", "portaudio":
+		return &portaudioBackend{}, nil
+	default:
+		return nil, fmt.Errorf("audio: unsupported backend %q on macOS", name)
+	}
+}
@@ -0,0 +1,47 @@
+//go:build linux
+
+package audio
+
+import "fmt"
+
+// newCaptureBackend resolves the backend name to a CaptureBackend on Linux.
+// "auto" prefers the PulseAudio monitor-source backend since it needs no
+// device selection, falling back to PortAudio for systems running bare ALSA.
+func newCaptureBackend(name string) (CaptureBackend, error) {
+	switch name {
+	case "", "auto":
+		return &autoBackend{}, nil
+	case "pulse":
+		return &pulseBackend{}, nil
+	case "portaudio":
+		return &portaudioBackend{}, nil
+	default:
+		return nil, fmt.Errorf("audio: unsupported backend %q on linux", name)
+	}
+}
+
+// autoBackend implements the "auto" backend's fallback: it opens
+// pulseBackend first, and if that fails (e.g. no PulseAudio socket, a bare
+// ALSA system) falls back to portaudioBackend instead of failing outright.
+// Once Open picks a backend, every other call is forwarded to it.
+type autoBackend struct {
+	CaptureBackend
+}
+
+func (b *autoBackend) Open(sampleRate, channels, bufferFrames int) error {
+	pulse := &pulseBackend{}
+	if err := pulse.Open(sampleRate, channels, bufferFrames); err == nil {
+		b.CaptureBackend = pulse
+		return nil
+	} else {
+		fmt.Println("audio: pulse backend unavailable, falling back to portaudio:", err)
+	}
+
+	pa := &portaudioBackend{}
+	if err := pa.Open(sampleRate, channels, bufferFrames); err != nil {
+		return fmt.Errorf("audio: no working backend (pulse and portaudio both failed): %w", err)
+	}
+
+	b.CaptureBackend = pa
+	return nil
+}
@@ -0,0 +1,117 @@
+//go:build linux || darwin
+
+package audio
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// portaudioBackend captures the default input device via PortAudio. On
+// Linux/macOS this is typically a loopback/monitor device configured at the
+// OS level (e.g. a PulseAudio "Monitor of ..." source, or BlackHole/Soundflower
+// on macOS).
+type portaudioBackend struct {
+	stream     *portaudio.Stream
+	buf        []int32
+	sampleRate int
+
+	frames chan frameResult
+}
+
+type frameResult struct {
+	samples []float64
+	err     error
+}
+
+func (b *portaudioBackend) Open(sampleRate, channels, bufferFrames int) error {
+	if err := portaudio.Initialize(); err != nil {
+		return err
+	}
+
+	b.buf = make([]int32, bufferFrames*channels)
+	b.frames = make(chan frameResult, 1)
+
+	stream, err := portaudio.OpenDefaultStream(channels, 0, float64(sampleRate), len(b.buf), func(in []int32) {
+		samples := make([]float64, len(in))
+		for i, s := range in {
+			samples[i] = float64(s)
+		}
+
+		select {
+		case b.frames <- frameResult{samples: samples}:
+		default:
+			// drop the frame if the consumer hasn't caught up yet
+		}
+	})
+	if err != nil {
+		portaudio.Terminate()
+		return err
+	}
+
+	if err := stream.Start(); err != nil {
+		stream.Close()
+		portaudio.Terminate()
+		return err
+	}
+
+	b.stream = stream
+	b.sampleRate = sampleRate
+
+	return nil
+}
+
+// SampleRate returns the rate requested of Open: PortAudio opens the
+// default device at that rate rather than negotiating its own.
+func (b *portaudioBackend) SampleRate() int {
+	return b.sampleRate
+}
+
+func (b *portaudioBackend) ReadFrame(ctx context.Context) ([]float64, float64, error) {
+	var f frameResult
+	select {
+	case <-ctx.Done():
+		return nil, 0, ctx.Err()
+	case fr, ok := <-b.frames:
+		if !ok {
+			return nil, 0, fmt.Errorf("audio: portaudio stream closed")
+		}
+		f = fr
+	}
+	if f.err != nil {
+		return nil, 0, f.err
+	}
+
+	var peak float64
+	for _, s := range f.samples {
+		if a := s / float64(1<<31); a > peak {
+			peak = a
+		} else if -a > peak {
+			peak = -a
+		}
+	}
+
+	return f.samples, peak, nil
+}
+
+// Close stops the stream and closes b.frames so that a ReadFrame blocked on
+// <-b.frames (e.g. because the device stopped delivering callbacks before
+// ctx was cancelled) unblocks rather than hanging until the backend is
+// reopened.
+func (b *portaudioBackend) Close() error {
+	var err error
+	if b.stream != nil {
+		err = b.stream.Stop()
+		b.stream.Close()
+	}
+
+	portaudio.Terminate()
+
+	if b.frames != nil {
+		close(b.frames)
+	}
+
+	return err
+}
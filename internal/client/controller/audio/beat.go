@@ -0,0 +1,150 @@
+package audio
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	noveltyHistory   = 43 // ~1s of history at a ~23ms frame period
+	onsetHistory     = 64
+	refractoryPeriod = 120 * time.Millisecond
+)
+
+// beatTracker estimates onsets and tempo from successive magnitude spectra.
+// Each frame is reduced to a spectral-flux novelty value; an adaptive
+// threshold over recent novelty picks onsets out of that signal, and
+// autocorrelating recent onset intervals over [minBPM,maxBPM] yields a
+// tempo estimate used to report the current phase within a beat.
+type beatTracker struct {
+	sensitivity float64
+	minBPM      float64
+	maxBPM      float64
+
+	prevMag []float64
+	novelty []float64
+
+	onsets    []time.Time
+	lastOnset time.Time
+	bpm       float64
+}
+
+func newBeatTracker(sensitivity, minBPM, maxBPM float64) *beatTracker {
+	if sensitivity <= 0 {
+		sensitivity = 1.5
+	}
+	if minBPM <= 0 {
+		minBPM = 60
+	}
+	if maxBPM <= 0 {
+		maxBPM = 200
+	}
+
+	return &beatTracker{sensitivity: sensitivity, minBPM: minBPM, maxBPM: maxBPM}
+}
+
+// update feeds the current frame's magnitude spectrum through the tracker
+// and reports whether an onset was detected this frame, along with the
+// current phase within the estimated beat (0 = on the beat, approaching 1
+// just before the next one). phase is 0 until a tempo estimate exists.
+func (t *beatTracker) update(mag []float64, now time.Time) (onset bool, phase float64) {
+	flux := spectralFlux(t.prevMag, mag)
+	t.prevMag = append(t.prevMag[:0], mag...)
+
+	t.novelty = append(t.novelty, flux)
+	if len(t.novelty) > noveltyHistory {
+		t.novelty = t.novelty[1:]
+	}
+
+	mean, std := meanStd(t.novelty)
+	threshold := mean + t.sensitivity*std
+
+	if flux > threshold && now.Sub(t.lastOnset) > refractoryPeriod {
+		onset = true
+		t.lastOnset = now
+
+		t.onsets = append(t.onsets, now)
+		if len(t.onsets) > onsetHistory {
+			t.onsets = t.onsets[1:]
+		}
+
+		t.bpm = estimateTempo(t.onsets, t.minBPM, t.maxBPM)
+	}
+
+	if t.bpm > 0 && !t.lastOnset.IsZero() {
+		beatDur := time.Minute / time.Duration(t.bpm)
+		phase = float64(now.Sub(t.lastOnset)%beatDur) / float64(beatDur)
+	}
+
+	return onset, phase
+}
+
+// spectralFlux sums the positive differences between successive magnitude
+// spectra, i.e. how much energy was added to the spectrum this frame.
+func spectralFlux(prev, cur []float64) float64 {
+	if len(prev) != len(cur) {
+		return 0
+	}
+
+	var sum float64
+	for i, c := range cur {
+		if d := c - prev[i]; d > 0 {
+			sum += d
+		}
+	}
+
+	return sum
+}
+
+func meanStd(xs []float64) (mean, std float64) {
+	if len(xs) == 0 {
+		return 0, 0
+	}
+
+	for _, x := range xs {
+		mean += x
+	}
+	mean /= float64(len(xs))
+
+	for _, x := range xs {
+		d := x - mean
+		std += d * d
+	}
+	std = math.Sqrt(std / float64(len(xs)))
+
+	return mean, std
+}
+
+// estimateTempo autocorrelates the intervals between recent onsets against
+// candidate beat periods in [minBPM,maxBPM] and returns the BPM whose
+// period best explains them.
+func estimateTempo(onsets []time.Time, minBPM, maxBPM float64) float64 {
+	if len(onsets) < 2 {
+		return 0
+	}
+
+	intervals := make([]float64, 0, len(onsets)-1)
+	for i := 1; i < len(onsets); i++ {
+		intervals = append(intervals, onsets[i].Sub(onsets[i-1]).Seconds())
+	}
+
+	var bestBPM, bestScore float64
+
+	for bpm := minBPM; bpm <= maxBPM; bpm++ {
+		period := 60 / bpm
+
+		var score float64
+		for _, iv := range intervals {
+			ratio := iv / period
+			frac := ratio - math.Round(ratio)
+			score += 1 / (1 + frac*frac*10)
+		}
+
+		if score > bestScore {
+			bestScore = score
+			bestBPM = bpm
+		}
+	}
+
+	return bestBPM
+}
@@ -0,0 +1,92 @@
+package audio
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSpectralFlux(t *testing.T) {
+	tests := []struct {
+		name      string
+		prev, cur []float64
+		want      float64
+	}{
+		{"nil prev (first frame)", nil, []float64{1, 2, 3}, 0},
+		{"length mismatch", []float64{1, 2}, []float64{1, 2, 3}, 0},
+		{"only positive deltas count", []float64{1, 5, 2}, []float64{3, 2, 4}, 4},
+		{"all decreasing is silent", []float64{5, 5, 5}, []float64{1, 2, 3}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := spectralFlux(tt.prev, tt.cur); got != tt.want {
+				t.Errorf("spectralFlux(%v, %v) = %v, want %v", tt.prev, tt.cur, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMeanStd(t *testing.T) {
+	mean, std := meanStd([]float64{2, 4, 4, 4, 5, 5, 7, 9})
+	if math.Abs(mean-5) > 1e-9 {
+		t.Errorf("mean = %v, want 5", mean)
+	}
+	if math.Abs(std-2) > 1e-9 {
+		t.Errorf("std = %v, want 2", std)
+	}
+}
+
+func TestMeanStdEmpty(t *testing.T) {
+	mean, std := meanStd(nil)
+	if mean != 0 || std != 0 {
+		t.Errorf("meanStd(nil) = (%v, %v), want (0, 0)", mean, std)
+	}
+}
+
+func TestEstimateTempoNeedsAtLeastTwoOnsets(t *testing.T) {
+	if got := estimateTempo([]time.Time{time.Now()}, 60, 200); got != 0 {
+		t.Errorf("estimateTempo() = %v, want 0", got)
+	}
+}
+
+// TestEstimateTempoSyntheticBPM feeds onsets spaced exactly one 120bpm beat
+// apart and checks the autocorrelation recovers 120, the kind of synthetic
+// flux/onset signal 638e315 needed to catch the raw-vs-normalized-magnitude
+// regression.
+func TestEstimateTempoSyntheticBPM(t *testing.T) {
+	const wantBPM = 120.0
+	period := time.Minute / time.Duration(wantBPM)
+
+	base := time.Unix(0, 0)
+	onsets := make([]time.Time, 20)
+	for i := range onsets {
+		onsets[i] = base.Add(time.Duration(i) * period)
+	}
+
+	if got := estimateTempo(onsets, 60, 200); math.Abs(got-wantBPM) > 1 {
+		t.Errorf("estimateTempo() = %v, want ~%v", got, wantBPM)
+	}
+}
+
+// TestBeatTrackerDetectsOnset drives update() with a steady-silence history
+// followed by a sudden energy jump, and checks the jump is reported as an
+// onset while the silent frames are not.
+func TestBeatTrackerDetectsOnset(t *testing.T) {
+	bt := newBeatTracker(1.5, 60, 200)
+	now := time.Now()
+
+	quiet := make([]float64, 8)
+	loud := []float64{5, 5, 5, 5, 5, 5, 5, 5}
+
+	for i := 0; i < 10; i++ {
+		if onset, _ := bt.update(quiet, now); onset {
+			t.Fatalf("unexpected onset on steady-state silence (frame %d)", i)
+		}
+		now = now.Add(25 * time.Millisecond)
+	}
+
+	if onset, _ := bt.update(loud, now); !onset {
+		t.Errorf("expected onset on sudden energy jump, got none")
+	}
+}
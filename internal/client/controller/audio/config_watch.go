@@ -0,0 +1,60 @@
+package audio
+
+import (
+	"image/color"
+
+	"github.com/lucasb-eyer/go-colorful"
+
+	"ledctl3/internal/server/config"
+	"ledctl3/pkg/gradient"
+)
+
+// ApplyConfigChange updates the running Visualizer in response to a hot
+// config reload (see config.Watch), without interrupting the capture
+// session underneath it.
+func (v *Visualizer) ApplyConfigChange(ch config.Change) {
+	if ch.Kind.Has(config.ChangeAudioColors) {
+		colors := make([]color.Color, 0, len(ch.Config.Audio.Colors))
+		for _, hex := range ch.Config.Audio.Colors {
+			c, err := colorful.Hex(hex)
+			if err != nil {
+				continue
+			}
+
+			colors = append(colors, c)
+		}
+
+		if g, err := gradient.New(colors...); err == nil {
+			v.mux.Lock()
+			v.colors = colors
+			v.gradient = g
+			v.mux.Unlock()
+		}
+	}
+
+	if ch.Kind.Has(config.ChangeAudioWindowSize) {
+		v.mux.Lock()
+		v.windowSize = ch.Config.Audio.WindowSize
+		if len(pixs) > v.windowSize {
+			pixs = pixs[len(pixs)-v.windowSize:]
+		}
+		v.mux.Unlock()
+	}
+
+	if ch.Kind.Has(config.ChangeSegments) {
+		segments := make([]Segment, 0, len(ch.Config.Segments))
+		for _, s := range ch.Config.Segments {
+			segments = append(segments, Segment{Id: s.Id, Leds: s.Leds})
+		}
+
+		// The events channel is not recreated here: Events() has already
+		// handed its reference to a subscriber that is ranging over it, and
+		// swapping v.events out from under it would strand that subscriber
+		// on the old channel while process sends to the new one. Capacity
+		// is sized once at construction; only the segment layout changes
+		// live.
+		v.mux.Lock()
+		v.segments = segments
+		v.mux.Unlock()
+	}
+}
@@ -0,0 +1,190 @@
+package audio
+
+import (
+	"math"
+	"time"
+)
+
+// melFilterbank maps a linear-frequency magnitude spectrum onto a fixed
+// number of triangular filters spaced uniformly on the Mel or Bark scale,
+// so LED resolution is spent where the ear (and most music) actually has
+// detail instead of being wasted on the top octaves.
+type melFilterbank struct {
+	weights [][]float64 // one row per band, one weight per FFT bin
+}
+
+// fftSize is the length of the real-valued signal the bins in nBins were
+// derived from (process passes len(samples)). The bin spacing is always
+// sampleRate/fftSize regardless of how many of the resulting bins are
+// actually handed to the filterbank, so it cannot be recovered from nBins
+// alone once the caller has truncated the spectrum to less than the full
+// 0..Nyquist half.
+func newMelFilterbank(nBins, nBands int, sampleRate, fMin, fMax float64, scale string, fftSize int) *melFilterbank {
+	// The caller only ever hands us the bottom half of the FFT output
+	// (process truncates coeff to coeff[:len(coeff)/2]), so the highest
+	// frequency actually representable by a bin is binHz*(nBins-1), not
+	// sampleRate/2: clamping fMax against the latter lets points round past
+	// nBins-1 and pile every band above the real ceiling onto the same last
+	// (flat) bin.
+	binHz := sampleRate / float64(fftSize)
+	maxHz := binHz * float64(nBins-1)
+
+	if fMax <= 0 || fMax > maxHz {
+		fMax = maxHz
+	}
+	if fMin < 0 {
+		fMin = 0
+	}
+
+	toScale, fromScale := hzToMel, melToHz
+	if scale == "bark" {
+		toScale, fromScale = hzToBark, barkToHz
+	}
+
+	lo, hi := toScale(fMin), toScale(fMax)
+
+	// nBands+2 points on the perceptual scale give nBands overlapping
+	// triangles, each sharing an edge with its neighbours.
+	points := make([]int, nBands+2)
+	for i := range points {
+		s := lo + (hi-lo)*float64(i)/float64(nBands+1)
+		idx := int(math.Round(fromScale(s) / binHz))
+		points[i] = clampInt(idx, 0, nBins-1)
+	}
+
+	fb := &melFilterbank{weights: make([][]float64, nBands)}
+	for b := 0; b < nBands; b++ {
+		lo, mid, hi := points[b], points[b+1], points[b+2]
+		row := make([]float64, nBins)
+
+		for i := lo; i < mid; i++ {
+			if mid > lo {
+				row[i] = float64(i-lo) / float64(mid-lo)
+			}
+		}
+		for i := mid; i < hi; i++ {
+			if hi > mid {
+				row[i] = float64(hi-i) / float64(hi-mid)
+			}
+		}
+		if mid == lo && mid == hi {
+			row[mid] = 1
+		}
+
+		fb.weights[b] = row
+	}
+
+	return fb
+}
+
+// apply reduces mag to one energy value per band.
+func (fb *melFilterbank) apply(mag []float64) []float64 {
+	out := make([]float64, len(fb.weights))
+
+	for b, row := range fb.weights {
+		n := len(row)
+		if len(mag) < n {
+			n = len(mag)
+		}
+
+		var sum float64
+		for i := 0; i < n; i++ {
+			sum += row[i] * mag[i]
+		}
+
+		out[b] = sum
+	}
+
+	return out
+}
+
+func hzToMel(hz float64) float64  { return 2595 * math.Log10(1+hz/700) }
+func melToHz(mel float64) float64 { return 700 * (math.Pow(10, mel/2595) - 1) }
+
+func hzToBark(hz float64) float64 {
+	return 13*math.Atan(0.00076*hz) + 3.5*math.Atan(math.Pow(hz/7500, 2))
+}
+
+// barkToHz has no closed form, so invert hzToBark with a bisection search.
+func barkToHz(bark float64) float64 {
+	lo, hi := 0.0, 24000.0
+	for i := 0; i < 40; i++ {
+		mid := (lo + hi) / 2
+		if hzToBark(mid) < bark {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+
+	return (lo + hi) / 2
+}
+
+func clampInt(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+
+	return v
+}
+
+// bandAGC runs an independent fast-attack/slow-release envelope follower
+// per band and normalizes each band by its own envelope, so a quiet band
+// still lights up and a loud band doesn't sit pinned at full brightness.
+type bandAGC struct {
+	attack     time.Duration
+	release    time.Duration
+	noiseFloor float64
+
+	envelope []float64
+	lastTime time.Time
+}
+
+func newBandAGC(nBands int, attack, release time.Duration, noiseFloor float64) *bandAGC {
+	return &bandAGC{
+		attack:     attack,
+		release:    release,
+		noiseFloor: noiseFloor,
+		envelope:   make([]float64, nBands),
+	}
+}
+
+func (a *bandAGC) apply(bands []float64, now time.Time) []float64 {
+	var dt time.Duration
+	if !a.lastTime.IsZero() {
+		dt = now.Sub(a.lastTime)
+	}
+	a.lastTime = now
+
+	out := make([]float64, len(bands))
+
+	for i, v := range bands {
+		if v < a.noiseFloor {
+			v = 0
+		}
+
+		tc := a.release
+		if v > a.envelope[i] {
+			tc = a.attack
+		}
+
+		coeff := 1.0
+		if tc > 0 && dt > 0 {
+			coeff = 1 - math.Exp(-float64(dt)/float64(tc))
+		}
+
+		a.envelope[i] += (v - a.envelope[i]) * coeff
+
+		gain := 0.0
+		if a.envelope[i] > 1e-9 {
+			gain = 1 / a.envelope[i]
+		}
+
+		out[i] = math.Min(v*gain, 1)
+	}
+
+	return out
+}
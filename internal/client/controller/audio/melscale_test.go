@@ -0,0 +1,102 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHzMelRoundTrip(t *testing.T) {
+	for _, hz := range []float64{20, 100, 440, 1000, 4000, 16000} {
+		if got := melToHz(hzToMel(hz)); math.Abs(got-hz) > 1e-6 {
+			t.Errorf("melToHz(hzToMel(%v)) = %v, want %v", hz, got, hz)
+		}
+	}
+}
+
+func TestHzBarkRoundTrip(t *testing.T) {
+	for _, hz := range []float64{20, 100, 440, 1000, 4000, 16000} {
+		if got := barkToHz(hzToBark(hz)); math.Abs(got-hz) > 1 {
+			t.Errorf("barkToHz(hzToBark(%v)) = %v, want ~%v", hz, got, hz)
+		}
+	}
+}
+
+// TestNewMelFilterbankCenterFrequencies checks each band's peak weight lands
+// on the bin nearest the center frequency the mel scale predicts for it.
+func TestNewMelFilterbankCenterFrequencies(t *testing.T) {
+	const (
+		sampleRate = 44100.0
+		fftSize    = 2048
+		nBins      = fftSize/2 + 1
+		nBands     = 4
+		fMin, fMax = 100.0, 8000.0
+	)
+
+	fb := newMelFilterbank(nBins, nBands, sampleRate, fMin, fMax, "mel", fftSize)
+	binHz := sampleRate / fftSize
+	lo, hi := hzToMel(fMin), hzToMel(fMax)
+
+	for b, row := range fb.weights {
+		wantHz := melToHz(lo + (hi-lo)*float64(b+1)/float64(nBands+1))
+		wantBin := clampInt(int(math.Round(wantHz/binHz)), 0, nBins-1)
+
+		if got := peakBin(row); got != wantBin {
+			t.Errorf("band %d: peak bin %d, want %d (center %.1f Hz)", b, got, wantBin, wantHz)
+		}
+	}
+}
+
+// TestNewMelFilterbankBinSpacingFromFFTSize is a regression test for
+// deriving bin spacing from the real FFT size rather than from nBins, which
+// changes whenever the caller has truncated the spectrum to less than the
+// full 0..Nyquist half.
+func TestNewMelFilterbankBinSpacingFromFFTSize(t *testing.T) {
+	const sampleRate = 44100.0
+
+	full := newMelFilterbank(1025, 4, sampleRate, 100, 8000, "mel", 2048)
+	truncated := newMelFilterbank(512, 4, sampleRate, 100, 8000, "mel", 2048)
+
+	for b := range truncated.weights {
+		if got, want := peakBin(truncated.weights[b]), peakBin(full.weights[b]); got != want {
+			t.Errorf("band %d: peak bin %d with nBins=512, want %d (should match nBins=1025 since fftSize is unchanged)", b, got, want)
+		}
+	}
+}
+
+// TestNewMelFilterbankClampsFMaxToRepresentableCeiling is a regression test
+// for clamping fMax against sampleRate/2: process only ever hands the
+// filterbank the bottom half of an already-halved real FFT spectrum
+// (coeff[:len(coeff)/2]), so the true ceiling is binHz*(nBins-1), well below
+// sampleRate/2. With the shipped default fMax of 16000 Hz and a 44.1kHz/
+// 1024-sample capture (nBins=256, binHz~43Hz, ceiling~11kHz), every band
+// above the real ceiling used to round to the same last bin and come out
+// flat.
+func TestNewMelFilterbankClampsFMaxToRepresentableCeiling(t *testing.T) {
+	const (
+		sampleRate = 44100.0
+		fftSize    = 1024
+		nBins      = 256
+		nBands     = 8
+	)
+
+	fb := newMelFilterbank(nBins, nBands, sampleRate, 30, 16000, "mel", fftSize)
+
+	seen := map[int]bool{}
+	for b, row := range fb.weights {
+		p := peakBin(row)
+		if seen[p] {
+			t.Fatalf("band %d: peak bin %d duplicates an earlier band's, fMax was not clamped to the representable ceiling", b, p)
+		}
+		seen[p] = true
+	}
+}
+
+func peakBin(row []float64) int {
+	p := 0
+	for i, w := range row {
+		if w > row[p] {
+			p = i
+		}
+	}
+	return p
+}
@@ -0,0 +1,83 @@
+package audio
+
+import (
+	"context"
+	"fmt"
+)
+
+// SampleFormat identifies the PCM sample layout produced by a decoder before
+// it is converted to the []float64 frames Visualizer.process expects.
+type SampleFormat int
+
+const (
+	SampleFormatU8 SampleFormat = iota
+	SampleFormatS16
+	SampleFormatS32
+	SampleFormatFLT
+)
+
+// sampleSource produces the PCM frames consumed by Visualizer.process. It is
+// the seam between "where do samples come from" (the OS mixer, a media
+// file, ...) and the rest of the visualizer, which only cares about
+// []float64 frames and an instantaneous peak level.
+type sampleSource interface {
+	Open(sampleRate, channels, bufferFrames int) error
+	// ReadSamples blocks until a frame is decoded/captured, ctx is
+	// cancelled, or the source fails.
+	ReadSamples(ctx context.Context) (samples []float64, peak float64, err error)
+	// SampleRate returns the rate samples are actually delivered at, which
+	// may differ from the sampleRate requested of Open (e.g. WASAPI
+	// negotiates its own mix format). Only valid after Open succeeds.
+	SampleRate() int
+	Close() error
+}
+
+// newSampleSource resolves the configured Audio.Source to a sampleSource.
+// "system" (the default) streams live audio through the CaptureBackend
+// selected by backend; "file" decodes sourcePath instead.
+func newSampleSource(source, sourcePath, backend string) (sampleSource, error) {
+	switch source {
+	case "", "system":
+		return &liveSource{backend: backend}, nil
+	case "file":
+		if sourcePath == "" {
+			return nil, fmt.Errorf("audio: source \"file\" requires Audio.SourcePath")
+		}
+		return &fileSource{path: sourcePath}, nil
+	default:
+		return nil, fmt.Errorf("audio: unsupported source %q", source)
+	}
+}
+
+// liveSource adapts a CaptureBackend to the sampleSource interface.
+type liveSource struct {
+	backend string
+	cap     CaptureBackend
+}
+
+func (s *liveSource) Open(sampleRate, channels, bufferFrames int) error {
+	cap, err := newCaptureBackend(s.backend)
+	if err != nil {
+		return err
+	}
+
+	if err := cap.Open(sampleRate, channels, bufferFrames); err != nil {
+		return err
+	}
+
+	s.cap = cap
+
+	return nil
+}
+
+func (s *liveSource) ReadSamples(ctx context.Context) ([]float64, float64, error) {
+	return s.cap.ReadFrame(ctx)
+}
+
+func (s *liveSource) SampleRate() int {
+	return s.cap.SampleRate()
+}
+
+func (s *liveSource) Close() error {
+	return s.cap.Close()
+}
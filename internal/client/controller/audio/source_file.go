@@ -0,0 +1,310 @@
+package audio
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/asticode/go-astiav"
+)
+
+// fileSource decodes PCM samples from a media file (mp3, flac, ogg, wav, ...)
+// instead of capturing live audio, so the visualizer can be driven by a
+// fixed input for testing, deterministic replays, and demos on machines
+// with no working CaptureBackend.
+type fileSource struct {
+	path string
+
+	fmtCtx   *astiav.FormatContext
+	codecCtx *astiav.CodecContext
+	stream   *astiav.Stream
+
+	pkt   *astiav.Packet
+	frame *astiav.Frame
+
+	format   SampleFormat
+	planar   bool
+	channels int // from the decoder's channel layout, not the Open caller's request
+
+	startWall time.Time
+}
+
+func (s *fileSource) Open(sampleRate, channels, bufferFrames int) error {
+	s.fmtCtx = astiav.AllocFormatContext()
+	if s.fmtCtx == nil {
+		return fmt.Errorf("audio: failed to allocate format context")
+	}
+
+	if err := s.fmtCtx.OpenInput(s.path, nil, nil); err != nil {
+		return fmt.Errorf("audio: opening %q: %w", s.path, err)
+	}
+
+	if err := s.fmtCtx.FindStreamInfo(nil); err != nil {
+		return fmt.Errorf("audio: probing %q: %w", s.path, err)
+	}
+
+	for _, st := range s.fmtCtx.Streams() {
+		if st.CodecParameters().MediaType() == astiav.MediaTypeAudio {
+			s.stream = st
+			break
+		}
+	}
+	if s.stream == nil {
+		return fmt.Errorf("audio: %q has no audio stream", s.path)
+	}
+
+	codec := astiav.FindDecoder(s.stream.CodecParameters().CodecID())
+	if codec == nil {
+		return fmt.Errorf("audio: no decoder for %q", s.path)
+	}
+
+	s.codecCtx = astiav.AllocCodecContext(codec)
+	if s.codecCtx == nil {
+		return fmt.Errorf("audio: failed to allocate codec context")
+	}
+
+	if err := s.stream.CodecParameters().ToCodecContext(s.codecCtx); err != nil {
+		return err
+	}
+
+	if err := s.codecCtx.Open(codec, nil); err != nil {
+		return err
+	}
+
+	s.format, s.planar = sampleFormatFromAV(s.codecCtx.SampleFormat().Name())
+	// Derive the interleave/plane count from the decoder's own channel
+	// layout rather than trusting the channels requested of Open: the
+	// caller always asks for defaultChannels (stereo), but mono files are
+	// common and decodeSamples indexes exactly channels planes/slots per
+	// sample, so a mismatch reads past the end of the decoded frame.
+	s.channels = s.codecCtx.ChannelLayout().Channels()
+	s.pkt = astiav.AllocPacket()
+	s.frame = astiav.AllocFrame()
+	s.startWall = time.Now()
+
+	return nil
+}
+
+// SampleRate returns the decoded file's native sample rate, which is
+// generally not the sampleRate requested of Open.
+func (s *fileSource) SampleRate() int {
+	if s.codecCtx == nil {
+		return 0
+	}
+
+	return s.codecCtx.SampleRate()
+}
+
+// ReadSamples decodes the next audio frame, converts it to []float64
+// samples in [-1,1]-scaled integer range (matching the live CaptureBackend
+// output), and sleeps as needed so playback is paced in real time against
+// the packet's presentation timestamp rather than decoded as fast as
+// possible. It returns early with ctx.Err() if ctx is cancelled while
+// waiting out that pacing sleep.
+func (s *fileSource) ReadSamples(ctx context.Context) ([]float64, float64, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		default:
+		}
+
+		if err := s.fmtCtx.ReadFrame(s.pkt); err != nil {
+			if err == io.EOF {
+				return nil, 0, io.EOF
+			}
+			return nil, 0, err
+		}
+
+		if s.pkt.StreamIndex() != s.stream.Index() {
+			s.pkt.Unref()
+			continue
+		}
+
+		if err := s.codecCtx.SendPacket(s.pkt); err != nil {
+			s.pkt.Unref()
+			return nil, 0, err
+		}
+		s.pkt.Unref()
+
+		if err := s.codecCtx.ReceiveFrame(s.frame); err != nil {
+			continue
+		}
+
+		samples, peak := decodeSamples(s.frame, s.format, s.channels, s.planar)
+
+		if pts := s.frame.Pts(); pts != astiav.NoPtsValue {
+			tb := s.stream.TimeBase()
+			target := time.Duration(float64(pts) * tb.Float64() * float64(time.Second))
+			if wait := target - time.Since(s.startWall); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return nil, 0, ctx.Err()
+				case <-timer.C:
+				}
+			}
+		}
+
+		s.frame.Unref()
+
+		return samples, peak, nil
+	}
+}
+
+func (s *fileSource) Close() error {
+	if s.frame != nil {
+		s.frame.Free()
+	}
+	if s.pkt != nil {
+		s.pkt.Free()
+	}
+	if s.codecCtx != nil {
+		s.codecCtx.Free()
+	}
+	if s.fmtCtx != nil {
+		s.fmtCtx.CloseInput()
+		s.fmtCtx.Free()
+	}
+
+	return nil
+}
+
+// sampleFormatFromAV maps a libav sample format name (astiav.SampleFormat's
+// Name(), e.g. "fltp") to our SampleFormat enum, along with whether the
+// format stores each channel in its own plane (e.g. ffmpeg commonly decodes
+// mp3/aac to fltp) rather than interleaved in a single plane. Takes the name
+// rather than astiav.SampleFormat itself so it can be unit tested without a
+// real libav sample format value.
+func sampleFormatFromAV(name string) (format SampleFormat, planar bool) {
+	switch name {
+	case "u8":
+		return SampleFormatU8, false
+	case "u8p":
+		return SampleFormatU8, true
+	case "s32":
+		return SampleFormatS32, false
+	case "s32p":
+		return SampleFormatS32, true
+	case "flt":
+		return SampleFormatFLT, false
+	case "fltp":
+		return SampleFormatFLT, true
+	case "s16p":
+		return SampleFormatS16, true
+	default:
+		return SampleFormatS16, false
+	}
+}
+
+// bytesPerSample returns the width of a single sample in format.
+func bytesPerSample(format SampleFormat) int {
+	switch format {
+	case SampleFormatU8:
+		return 1
+	case SampleFormatS16:
+		return 2
+	default: // SampleFormatS32, SampleFormatFLT
+		return 4
+	}
+}
+
+// peakScale returns the divisor that maps format's full-scale integer
+// representation (as produced by decodeScalar) down to [0,1].
+func peakScale(format SampleFormat) float64 {
+	switch format {
+	case SampleFormatU8:
+		return 128
+	case SampleFormatS16:
+		return 1 << 15
+	default: // SampleFormatS32, SampleFormatFLT
+		return 1 << 31
+	}
+}
+
+// decodeScalar reads a single sample of format from the front of b, scaled
+// to match the integer range used by the live CaptureBackend implementations.
+func decodeScalar(b []byte, format SampleFormat) float64 {
+	switch format {
+	case SampleFormatU8:
+		return float64(int(b[0]) - 128)
+	case SampleFormatS32:
+		return float64(readInt32(b))
+	case SampleFormatFLT:
+		bits := uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+		return float64(math.Float32frombits(bits)) * float64(int64(1)<<31)
+	default: // SampleFormatS16
+		return float64(readInt16(b))
+	}
+}
+
+// decodeSamples converts a decoded frame's samples to interleaved float64,
+// scaled to match the integer range used by the live CaptureBackend
+// implementations, and returns the peak absolute sample value normalized to
+// [0,1]. planar frames store each channel in its own plane (frame.Data()
+// plane index == channel index); packed frames interleave every channel in
+// plane 0. The actual byte-to-float64 conversion lives in
+// decodePlanarSamples/decodePackedSamples so it can be unit tested without
+// an astiav.Frame.
+func decodeSamples(frame *astiav.Frame, format SampleFormat, channels int, planar bool) ([]float64, float64) {
+	n := frame.NbSamples()
+
+	if planar {
+		planes := make([][]byte, channels)
+		for c := 0; c < channels; c++ {
+			planes[c] = frame.Data().Bytes(c)
+		}
+		return decodePlanarSamples(planes, n, format)
+	}
+
+	return decodePackedSamples(frame.Data().Bytes(0), n, channels, format)
+}
+
+// decodePlanarSamples interleaves n samples per channel out of planes (one
+// byte slice per channel, plane index == channel index) into []float64,
+// scaled to match the integer range used by the live CaptureBackend
+// implementations, and returns the peak absolute sample value normalized to
+// [0,1].
+func decodePlanarSamples(planes [][]byte, n int, format SampleFormat) ([]float64, float64) {
+	bps := bytesPerSample(format)
+	channels := len(planes)
+
+	samples := make([]float64, n*channels)
+	var peakRaw float64
+
+	for c, data := range planes {
+		for i := 0; i < n; i++ {
+			v := decodeScalar(data[i*bps:i*bps+bps], format)
+			samples[i*channels+c] = v
+			if a := math.Abs(v); a > peakRaw {
+				peakRaw = a
+			}
+		}
+	}
+
+	return samples, peakRaw / peakScale(format)
+}
+
+// decodePackedSamples converts n*channels samples interleaved in data into
+// []float64, scaled to match the integer range used by the live
+// CaptureBackend implementations, and returns the peak absolute sample
+// value normalized to [0,1].
+func decodePackedSamples(data []byte, n, channels int, format SampleFormat) ([]float64, float64) {
+	bps := bytesPerSample(format)
+
+	samples := make([]float64, n*channels)
+	var peakRaw float64
+
+	for i := range samples {
+		v := decodeScalar(data[i*bps:i*bps+bps], format)
+		samples[i] = v
+		if a := math.Abs(v); a > peakRaw {
+			peakRaw = a
+		}
+	}
+
+	return samples, peakRaw / peakScale(format)
+}
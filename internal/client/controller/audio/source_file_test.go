@@ -0,0 +1,116 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDecodeScalar(t *testing.T) {
+	tests := []struct {
+		name   string
+		format SampleFormat
+		b      []byte
+		want   float64
+	}{
+		{"u8 midpoint", SampleFormatU8, []byte{128}, 0},
+		{"u8 max", SampleFormatU8, []byte{255}, 127},
+		{"u8 min", SampleFormatU8, []byte{0}, -128},
+		{"s16 positive", SampleFormatS16, []byte{0xFF, 0x7F}, 32767},
+		{"s16 negative", SampleFormatS16, []byte{0x00, 0x80}, -32768},
+		{"s32 positive", SampleFormatS32, []byte{0xFF, 0xFF, 0xFF, 0x7F}, 2147483647},
+		{"flt zero", SampleFormatFLT, []byte{0, 0, 0, 0}, 0},
+		{"flt full scale", SampleFormatFLT, float32Bytes(1.0), float64(int64(1) << 31)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeScalar(tt.b, tt.format); got != tt.want {
+				t.Errorf("decodeScalar(%v, %v) = %v, want %v", tt.b, tt.format, got, tt.want)
+			}
+		})
+	}
+}
+
+func float32Bytes(f float32) []byte {
+	bits := math.Float32bits(f)
+	return []byte{byte(bits), byte(bits >> 8), byte(bits >> 16), byte(bits >> 24)}
+}
+
+// TestDecodePackedSamples covers the non-planar (interleaved) decode path
+// decodeSamples uses for formats like s16/flt, which is where f28c139 had
+// to fix float/s32 handling.
+func TestDecodePackedSamples(t *testing.T) {
+	// Two channels, two frames of s16: L0=1000 R0=-1000 L1=2000 R1=-32768.
+	data := []byte{
+		0xE8, 0x03, // 1000
+		0x18, 0xFC, // -1000
+		0xD0, 0x07, // 2000
+		0x00, 0x80, // -32768
+	}
+
+	samples, peak := decodePackedSamples(data, 2, 2, SampleFormatS16)
+
+	want := []float64{1000, -1000, 2000, -32768}
+	for i, w := range want {
+		if samples[i] != w {
+			t.Errorf("samples[%d] = %v, want %v", i, samples[i], w)
+		}
+	}
+
+	wantPeak := 32768.0 / peakScale(SampleFormatS16)
+	if math.Abs(peak-wantPeak) > 1e-9 {
+		t.Errorf("peak = %v, want %v", peak, wantPeak)
+	}
+}
+
+// TestDecodePlanarSamples covers the planar decode path (each channel in
+// its own plane, e.g. ffmpeg's fltp/s32p), which 3424986 fixed to index the
+// right number of planes.
+func TestDecodePlanarSamples(t *testing.T) {
+	// Two channels, three frames of u8: L = [130, 0, 255], R = [128, 64, 1].
+	planes := [][]byte{
+		{130, 0, 255},
+		{128, 64, 1},
+	}
+
+	samples, peak := decodePlanarSamples(planes, 3, SampleFormatU8)
+
+	want := []float64{2, 0, -128, -64, 127, -127}
+	for i, w := range want {
+		if samples[i] != w {
+			t.Errorf("samples[%d] = %v, want %v", i, samples[i], w)
+		}
+	}
+
+	wantPeak := 128.0 / peakScale(SampleFormatU8)
+	if math.Abs(peak-wantPeak) > 1e-9 {
+		t.Errorf("peak = %v, want %v", peak, wantPeak)
+	}
+}
+
+func TestSampleFormatFromAV(t *testing.T) {
+	tests := []struct {
+		name       string
+		avName     string
+		wantFormat SampleFormat
+		wantPlanar bool
+	}{
+		{"u8", "u8", SampleFormatU8, false},
+		{"u8 planar", "u8p", SampleFormatU8, true},
+		{"s16 planar", "s16p", SampleFormatS16, true},
+		{"s32", "s32", SampleFormatS32, false},
+		{"s32 planar", "s32p", SampleFormatS32, true},
+		{"float", "flt", SampleFormatFLT, false},
+		{"float planar", "fltp", SampleFormatFLT, true},
+		{"unknown falls back to s16", "dbl", SampleFormatS16, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, planar := sampleFormatFromAV(tt.avName)
+			if format != tt.wantFormat || planar != tt.wantPlanar {
+				t.Errorf("sampleFormatFromAV(%q) = (%v, %v), want (%v, %v)", tt.avName, format, planar, tt.wantFormat, tt.wantPlanar)
+			}
+		})
+	}
+}
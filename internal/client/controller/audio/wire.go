@@ -0,0 +1,57 @@
+package audio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"ledctl3/internal/server/config"
+)
+
+// NewFromConfig builds a Visualizer from the audio section of cfg, wiring
+// every configurable knob (capture backend, sample source, beat tracking,
+// spectrum scale) through to its matching Option alongside whatever other
+// options the caller needs (colors, segments, ...).
+func NewFromConfig(cfg *config.Config, opts ...Option) (*Visualizer, error) {
+	all := append([]Option{
+		Backend(cfg.Audio.Backend),
+		Source(cfg.Audio.Source, cfg.Audio.SourcePath),
+		Beat(cfg.Audio.BeatMode, cfg.Audio.Sensitivity, cfg.Audio.MinBPM, cfg.Audio.MaxBPM),
+		Scale(
+			cfg.Audio.Scale,
+			cfg.Audio.FMin,
+			cfg.Audio.FMax,
+			time.Duration(cfg.Audio.AttackMs)*time.Millisecond,
+			time.Duration(cfg.Audio.ReleaseMs)*time.Millisecond,
+			cfg.Audio.NoiseFloor,
+		),
+	}, opts...)
+
+	return New(all...)
+}
+
+// Run builds a Visualizer from cfg, starts it, and subscribes it to
+// config.Watch so that edits to the colors, window size and segments take
+// effect without restarting capture. Edits to the backend, source, beat and
+// scale fields are not applied to the running Visualizer. It returns once
+// the Visualizer is started; the watch runs in the background until ctx is
+// cancelled.
+func Run(ctx context.Context, cfg *config.Config, opts ...Option) (*Visualizer, error) {
+	v, err := NewFromConfig(cfg, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := v.Start(); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		if err := config.Watch(ctx, cfg, v.ApplyConfigChange); err != nil && !errors.Is(err, context.Canceled) {
+			fmt.Println("audio: config watch stopped:", err)
+		}
+	}()
+
+	return v, nil
+}
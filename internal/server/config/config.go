@@ -15,11 +15,44 @@ type Config struct {
 	Displays    [][]Display `yaml:"displays" json:"displays"`
 	Audio       AudioConfig `yaml:"audio" json:"audio"`
 	Segments    []Segment   `yaml:"segments" json:"segments"`
+
+	format string
+	name   string
 }
 
 type AudioConfig struct {
 	Colors     []string `yaml:"colors" json:"colors"`
 	WindowSize int      `yaml:"windowSize" json:"windowSize"`
+
+	// Backend selects the audio capture API: "wasapi", "portaudio", "pulse",
+	// or "auto" to pick a sensible default for the current OS.
+	Backend string `yaml:"backend" json:"backend"`
+
+	// Source selects where samples come from: "system" captures live audio
+	// through Backend, "file" decodes SourcePath instead.
+	Source     string `yaml:"source" json:"source"`
+	SourcePath string `yaml:"sourcePath" json:"sourcePath"`
+
+	// BeatMode enables beat-synchronous coloring: "off" (the default),
+	// "pulse" (flash on each detected onset) or "breathe" (brightness
+	// follows the beat phase).
+	BeatMode string `yaml:"beatMode" json:"beatMode"`
+	// Sensitivity raises or lowers the onset threshold above the novelty
+	// function's recent mean; higher values require a sharper transient.
+	Sensitivity float64 `yaml:"sensitivity" json:"sensitivity"`
+	MinBPM      float64 `yaml:"minBpm" json:"minBpm"`
+	MaxBPM      float64 `yaml:"maxBpm" json:"maxBpm"`
+
+	// Scale selects how the spectrum is mapped onto LEDs: "log" (the
+	// default), "linear", "mel" or "bark". FMin/FMax bound the mel/bark
+	// filterbank in Hz, and AttackMs/ReleaseMs/NoiseFloor configure the
+	// per-band AGC that follows it.
+	Scale      string  `yaml:"scale" json:"scale"`
+	FMin       float64 `yaml:"fMin" json:"fMin"`
+	FMax       float64 `yaml:"fMax" json:"fMax"`
+	AttackMs   int     `yaml:"attackMs" json:"attackMs"`
+	ReleaseMs  int     `yaml:"releaseMs" json:"releaseMs"`
+	NoiseFloor float64 `yaml:"noiseFloor" json:"noiseFloor"`
 }
 
 type Server struct {
@@ -87,44 +120,45 @@ func (c *Config) Save() error {
 	return nil
 }
 
-func Load() (*Config, error) {
-	validCfgs := map[string]string{
-		"ledctl.json": "json",
-		"ledctl.yaml": "yaml",
-		"ledctl.yml":  "yaml",
-	}
+var validCfgs = map[string]string{
+	"ledctl.json": "json",
+	"ledctl.yaml": "yaml",
+	"ledctl.yml":  "yaml",
+}
 
+func Load() (*Config, error) {
 	for name, format := range validCfgs {
 		if _, err := os.Stat(name); err == nil {
-			b, err := os.ReadFile(name)
-			if err != nil {
-				return nil, err
-			}
-
-			var c Config
-
-			switch format {
-			case "json":
-				if err := json.Unmarshal(b, &c); err != nil {
-					return nil, err
-				}
+			return loadFile(name, format)
+		}
+	}
 
-				c.format = "json"
-			case "yaml":
-				if err := yaml.Unmarshal(b, &c); err != nil {
-					return nil, err
-				}
+	return createDefault()
+}
 
-				c.format = "yaml"
-			}
+func loadFile(name, format string) (*Config, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
 
-			c.name = name
+	var c Config
 
-			return &c, nil
+	switch format {
+	case "json":
+		if err := json.Unmarshal(b, &c); err != nil {
+			return nil, err
+		}
+	case "yaml":
+		if err := yaml.Unmarshal(b, &c); err != nil {
+			return nil, err
 		}
 	}
 
-	return createDefault()
+	c.format = format
+	c.name = name
+
+	return &c, nil
 }
 
 func createDefault() (*Config, error) {
@@ -169,7 +203,19 @@ func createDefault() (*Config, error) {
 				"#c66c86",
 				"#ff7582",
 			},
-			WindowSize: 80,
+			WindowSize:  80,
+			Backend:     "auto",
+			Source:      "system",
+			BeatMode:    "off",
+			Sensitivity: 1.5,
+			MinBPM:      60,
+			MaxBPM:      200,
+			Scale:       "log",
+			FMin:        30,
+			FMax:        16000,
+			AttackMs:    10,
+			ReleaseMs:   300,
+			NoiseFloor:  0.02,
 		},
 	}
 
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// debounceWindow coalesces the burst of writes an editor or config-writing
+// tool tends to produce into a single reload.
+const debounceWindow = 200 * time.Millisecond
+
+// ChangeKind is a bitmask identifying which parts of a Config changed
+// between two reloads, so subscribers can cheaply ignore reloads that don't
+// affect them.
+type ChangeKind int
+
+const (
+	ChangeAudioColors ChangeKind = 1 << iota
+	ChangeAudioWindowSize
+	ChangeServerBrightness
+	ChangeDisplays
+	ChangeSegments
+)
+
+// Has reports whether kind is set in c.
+func (c ChangeKind) Has(kind ChangeKind) bool {
+	return c&kind != 0
+}
+
+// Change describes a config reload: the freshly parsed Config and a bitmask
+// of what changed relative to the previous one.
+type Change struct {
+	Config *Config
+	Kind   ChangeKind
+}
+
+// Watch watches c's backing file for writes, debounces them, re-parses the
+// file, diffs the result against c, and invokes onChange with the new
+// Config and what changed whenever a diff is non-empty. *c is updated in
+// place before onChange is called. It blocks until ctx is cancelled.
+//
+// The parent directory is watched rather than c.name directly, and events
+// are filtered down to that one file by name: many editors and
+// config-writing tools save atomically (write a temp file, then rename it
+// over the target), which swaps the target's inode and leaves a watch on
+// the old path permanently silent after the first reload.
+func Watch(ctx context.Context, c *Config, onChange func(Change)) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	dir := filepath.Dir(c.name)
+	name := filepath.Base(c.name)
+
+	if err := w.Add(dir); err != nil {
+		return err
+	}
+
+	var timer *time.Timer
+	reload := make(chan struct{}, 1)
+
+	armDebounce := func() {
+		if timer == nil {
+			timer = time.AfterFunc(debounceWindow, func() {
+				select {
+				case reload <- struct{}{}:
+				default:
+				}
+			})
+			return
+		}
+
+		timer.Reset(debounceWindow)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			if filepath.Base(ev.Name) != name {
+				continue
+			}
+			if ev.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+				armDebounce()
+			}
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			return err
+		case <-reload:
+			next, err := loadFile(c.name, c.format)
+			if err != nil {
+				// Keep watching: the file is likely mid-write and will
+				// settle on the next debounced reload.
+				continue
+			}
+
+			kind := diff(c, next)
+			if kind == 0 {
+				continue
+			}
+
+			*c = *next
+			onChange(Change{Config: c, Kind: kind})
+		}
+	}
+}
+
+func diff(old, next *Config) ChangeKind {
+	var kind ChangeKind
+
+	if !reflect.DeepEqual(old.Audio.Colors, next.Audio.Colors) {
+		kind |= ChangeAudioColors
+	}
+	if old.Audio.WindowSize != next.Audio.WindowSize {
+		kind |= ChangeAudioWindowSize
+	}
+	if old.Server.Brightness != next.Server.Brightness {
+		kind |= ChangeServerBrightness
+	}
+	if !reflect.DeepEqual(old.Displays, next.Displays) {
+		kind |= ChangeDisplays
+	}
+	if !reflect.DeepEqual(old.Segments, next.Segments) {
+		kind |= ChangeSegments
+	}
+
+	return kind
+}
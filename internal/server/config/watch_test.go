@@ -0,0 +1,54 @@
+package config
+
+import "testing"
+
+func TestDiff(t *testing.T) {
+	base := &Config{
+		Audio: AudioConfig{
+			Colors:     []string{"#000000"},
+			WindowSize: 80,
+		},
+		Server:   Server{Brightness: 255},
+		Displays: [][]Display{{{Segment: 0}}},
+		Segments: []Segment{{Id: 0, Leds: 100}},
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		want   ChangeKind
+	}{
+		{"no change", func(c *Config) {}, 0},
+		{"colors", func(c *Config) { c.Audio.Colors = []string{"#ffffff"} }, ChangeAudioColors},
+		{"window size", func(c *Config) { c.Audio.WindowSize = 120 }, ChangeAudioWindowSize},
+		{"brightness", func(c *Config) { c.Server.Brightness = 128 }, ChangeServerBrightness},
+		{"displays", func(c *Config) { c.Displays = [][]Display{{{Segment: 1}}} }, ChangeDisplays},
+		{"segments", func(c *Config) { c.Segments = []Segment{{Id: 1, Leds: 50}} }, ChangeSegments},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := *base
+			next.Audio.Colors = append([]string(nil), base.Audio.Colors...)
+			next.Displays = append([][]Display(nil), base.Displays...)
+			next.Segments = append([]Segment(nil), base.Segments...)
+			tt.modify(&next)
+
+			if got := diff(base, &next); got != tt.want {
+				t.Errorf("diff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestDiffCombinesKinds checks that simultaneous changes across unrelated
+// fields set every corresponding bit rather than overwriting one another.
+func TestDiffCombinesKinds(t *testing.T) {
+	old := &Config{Audio: AudioConfig{WindowSize: 80}, Server: Server{Brightness: 255}}
+	next := &Config{Audio: AudioConfig{WindowSize: 120}, Server: Server{Brightness: 128}}
+
+	want := ChangeAudioWindowSize | ChangeServerBrightness
+	if got := diff(old, next); got != want {
+		t.Errorf("diff() = %v, want %v", got, want)
+	}
+}